@@ -0,0 +1,10 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package event
+
+import "errors"
+
+// ErrInvalidParameter is returned when an invalid parameter is supplied to a
+// function or method within the event package.
+var ErrInvalidParameter = errors.New("invalid parameter")
@@ -0,0 +1,49 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+// Package filelock provides a small, cross-platform advisory file lock.
+// It's used by event sinks that may share a single file across separate
+// processes (for example an active/standby pair pointed at the same audit
+// volume) and need writes to stay atomic beyond PIPE_BUF.
+//
+// The design mirrors the Go toolchain's cmd/go/internal/lockedfile package:
+// a thin wrapper around *os.File that adds Lock/Unlock, with the actual
+// locking syscalls supplied per-platform.
+package filelock
+
+import (
+	"errors"
+	"os"
+)
+
+// ErrNotSupported is returned by Lock/Unlock on platforms where advisory
+// file locking isn't implemented.
+var ErrNotSupported = errors.New("filelock: file locking is not supported on this platform")
+
+// File wraps an *os.File with advisory locking. The zero value is not
+// usable; construct one with Open or by wrapping an already-open *os.File.
+type File struct {
+	*os.File
+}
+
+// Open opens the named file, as os.OpenFile would, returning a File whose
+// Lock/Unlock methods operate on the resulting descriptor.
+func Open(name string, flag int, perm os.FileMode) (*File, error) {
+	f, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &File{File: f}, nil
+}
+
+// Lock places an exclusive, whole-file advisory lock, blocking until it's
+// available. It's released by Unlock, or implicitly when the file is
+// closed.
+func (f *File) Lock() error {
+	return lock(f.File)
+}
+
+// Unlock releases a lock previously acquired with Lock.
+func (f *File) Unlock() error {
+	return unlock(f.File)
+}
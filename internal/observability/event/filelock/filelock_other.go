@@ -0,0 +1,20 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build !unix && !windows
+
+package filelock
+
+import "os"
+
+// lock is a no-op stub for platforms without an advisory locking
+// implementation.
+func lock(_ *os.File) error {
+	return ErrNotSupported
+}
+
+// unlock is a no-op stub for platforms without an advisory locking
+// implementation.
+func unlock(_ *os.File) error {
+	return ErrNotSupported
+}
@@ -0,0 +1,47 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build linux || illumos || solaris
+
+package filelock
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// lock acquires an exclusive, whole-file advisory lock via fcntl(2)
+// F_OFD_SETLKW, blocking until it's available. Unlike classic fcntl(2)
+// F_SETLK record locks, open file description locks are associated with the
+// open file description rather than the process, so independent processes that open the same path each
+// get their own lock that composes correctly and is visible across them.
+//
+// F_OFD_SETLK/F_OFD_SETLKW are only implemented on Linux, illumos, and
+// Solaris; the rest of the unix build-tag family (darwin, the BSDs, etc.)
+// is handled by filelock_unix_flock.go instead.
+func lock(f *os.File) error {
+	fl := unix.Flock_t{
+		Type:   unix.F_WRLCK,
+		Whence: 0, // io.SeekStart
+		Start:  0,
+		Len:    0,
+	}
+	for {
+		err := unix.FcntlFlock(f.Fd(), unix.F_OFD_SETLKW, &fl)
+		if err != unix.EINTR {
+			return err
+		}
+	}
+}
+
+// unlock releases a lock previously acquired with lock.
+func unlock(f *os.File) error {
+	fl := unix.Flock_t{
+		Type:   unix.F_UNLCK,
+		Whence: 0, // io.SeekStart
+		Start:  0,
+		Len:    0,
+	}
+	return unix.FcntlFlock(f.Fd(), unix.F_OFD_SETLK, &fl)
+}
@@ -0,0 +1,35 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build unix && !linux && !illumos && !solaris
+
+package filelock
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// lock acquires an exclusive, whole-file advisory lock via flock(2),
+// blocking until it's available.
+//
+// flock(2) locks are associated with the open file description on the BSDs
+// (including Darwin), which gives the same cross-process semantics as the
+// F_OFD_* fcntl locks used on Linux/illumos/Solaris; it's only on Linux
+// specifically that flock(2) and fcntl locks are independent of one
+// another, which is why that platform gets the dedicated F_OFD_* path in
+// filelock_unix.go instead.
+func lock(f *os.File) error {
+	for {
+		err := unix.Flock(int(f.Fd()), unix.LOCK_EX)
+		if err != unix.EINTR {
+			return err
+		}
+	}
+}
+
+// unlock releases a lock previously acquired with lock.
+func unlock(f *os.File) error {
+	return unix.Flock(int(f.Fd()), unix.LOCK_UN)
+}
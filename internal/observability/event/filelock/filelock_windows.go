@@ -0,0 +1,36 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build windows
+
+package filelock
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lock acquires an exclusive, whole-file advisory lock via LockFileEx,
+// blocking until it's available.
+func lock(f *os.File) error {
+	ol := new(windows.Overlapped)
+	return windows.LockFileEx(
+		windows.Handle(f.Fd()),
+		windows.LOCKFILE_EXCLUSIVE_LOCK,
+		0,
+		^uint32(0), ^uint32(0),
+		ol,
+	)
+}
+
+// unlock releases a lock previously acquired with lock.
+func unlock(f *os.File) error {
+	ol := new(windows.Overlapped)
+	return windows.UnlockFileEx(
+		windows.Handle(f.Fd()),
+		0,
+		^uint32(0), ^uint32(0),
+		ol,
+	)
+}
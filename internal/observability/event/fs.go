@@ -0,0 +1,52 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package event
+
+import (
+	"io"
+	"os"
+)
+
+// File is the subset of *os.File that FileSink needs from a WritableFS.
+// *os.File satisfies this interface, so OSFS can return one directly.
+type File interface {
+	io.Reader
+	io.Writer
+	io.Closer
+
+	Stat() (os.FileInfo, error)
+	Sync() error
+}
+
+// WritableFS is the filesystem abstraction FileSink writes through, rather
+// than calling os.* directly. This lets FileSink's rotation/reopen logic be
+// exercised deterministically in tests against MemFS, and lets callers plug
+// in alternative backends without duplicating that logic.
+type WritableFS interface {
+	// OpenFile opens the named file with the given os.O_* flags and
+	// permissions, creating it if os.O_CREATE is set.
+	OpenFile(name string, flag int, perm os.FileMode) (File, error)
+	// MkdirAll creates a directory, and any necessary parents, with the
+	// given permissions. It's a no-op if the directory already exists.
+	MkdirAll(path string, perm os.FileMode) error
+	// Chmod changes the named file's mode.
+	Chmod(name string, mode os.FileMode) error
+	// Rename renames (moves) oldpath to newpath.
+	Rename(oldpath, newpath string) error
+	// Remove removes the named file.
+	Remove(name string) error
+	// Stat returns file info describing the named file.
+	Stat(name string) (os.FileInfo, error)
+	// Glob returns the names of all files matching pattern, using the same
+	// syntax as path/filepath.Match.
+	Glob(pattern string) ([]string, error)
+}
+
+// DirSyncer is optionally implemented by a WritableFS that can fsync a
+// directory, so a preceding Rename is made durable before the caller
+// proceeds. OSFS implements it; in-memory backends such as MemFS have no
+// on-disk directory entries to sync and don't need to.
+type DirSyncer interface {
+	SyncDir(path string) error
+}
@@ -0,0 +1,218 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package event
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemFS is an in-memory WritableFS, suitable for unit tests and for
+// ephemeral audit capture where durability across process restarts isn't
+// required. It implements the same append/reopen/rotate semantics FileSink
+// expects from a real filesystem.
+type MemFS struct {
+	mu    sync.Mutex
+	files map[string]*memFileData
+}
+
+// memFileData is the shared, mutable backing store for a path. Multiple
+// memFile handles opened against the same path all observe the same data.
+type memFileData struct {
+	data    []byte
+	mode    os.FileMode
+	modTime time.Time
+}
+
+// NewMemFS returns an empty MemFS ready for use.
+func NewMemFS() *MemFS {
+	return &MemFS{files: make(map[string]*memFileData)}
+}
+
+// OpenFile implements WritableFS.
+func (m *MemFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, exists := m.files[name]
+	switch {
+	case !exists && flag&os.O_CREATE != 0:
+		f = &memFileData{mode: perm, modTime: time.Now()}
+		m.files[name] = f
+	case !exists:
+		return nil, os.ErrNotExist
+	case flag&os.O_TRUNC != 0:
+		f.data = nil
+		f.modTime = time.Now()
+	}
+
+	return &memFile{fs: m, name: name}, nil
+}
+
+// MkdirAll implements WritableFS. MemFS has no real directory entries, so
+// this only validates that name isn't empty; intermediate directories are
+// implied by file paths.
+func (m *MemFS) MkdirAll(path string, _ os.FileMode) error {
+	if path == "" {
+		return os.ErrInvalid
+	}
+	return nil
+}
+
+// Chmod implements WritableFS.
+func (m *MemFS) Chmod(name string, mode os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.files[name]
+	if !ok {
+		return os.ErrNotExist
+	}
+	f.mode = mode
+	return nil
+}
+
+// Rename implements WritableFS.
+func (m *MemFS) Rename(oldpath, newpath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.files[oldpath]
+	if !ok {
+		return os.ErrNotExist
+	}
+	m.files[newpath] = f
+	delete(m.files, oldpath)
+	return nil
+}
+
+// Remove implements WritableFS.
+func (m *MemFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.files[name]; !ok {
+		return os.ErrNotExist
+	}
+	delete(m.files, name)
+	return nil
+}
+
+// Stat implements WritableFS.
+func (m *MemFS) Stat(name string) (os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.files[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return newMemFileInfo(name, f), nil
+}
+
+// Glob implements WritableFS.
+func (m *MemFS) Glob(pattern string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var matches []string
+	for name := range m.files {
+		ok, err := filepath.Match(pattern, name)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matches = append(matches, name)
+		}
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// memFile is a File handle onto a path's memFileData. Writes always append,
+// matching the O_APPEND mode FileSink opens its log file with (its temp and
+// compressed segments are opened with O_TRUNC and written sequentially, so
+// appending gives the same result); reads proceed sequentially from the
+// start, which is all compressSegment needs.
+type memFile struct {
+	fs     *MemFS
+	name   string
+	offset int
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	data, ok := f.fs.files[f.name]
+	if !ok {
+		return 0, os.ErrClosed
+	}
+	data.data = append(data.data, p...)
+	data.modTime = time.Now()
+	return len(p), nil
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	data, ok := f.fs.files[f.name]
+	if !ok {
+		return 0, os.ErrClosed
+	}
+	if f.offset >= len(data.data) {
+		return 0, io.EOF
+	}
+	n := copy(p, data.data[f.offset:])
+	f.offset += n
+	return n, nil
+}
+
+func (f *memFile) Close() error {
+	return nil
+}
+
+func (f *memFile) Sync() error {
+	return nil
+}
+
+func (f *memFile) Stat() (os.FileInfo, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	data, ok := f.fs.files[f.name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return newMemFileInfo(f.name, data), nil
+}
+
+// memFileInfo implements os.FileInfo for a MemFS entry.
+type memFileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func newMemFileInfo(name string, f *memFileData) *memFileInfo {
+	return &memFileInfo{
+		name:    filepath.Base(name),
+		size:    int64(len(f.data)),
+		mode:    f.mode,
+		modTime: f.modTime,
+	}
+}
+
+func (i *memFileInfo) Name() string       { return i.name }
+func (i *memFileInfo) Size() int64        { return i.size }
+func (i *memFileInfo) Mode() os.FileMode  { return i.mode }
+func (i *memFileInfo) ModTime() time.Time { return i.modTime }
+func (i *memFileInfo) IsDir() bool        { return false }
+func (i *memFileInfo) Sys() any           { return nil }
@@ -0,0 +1,60 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package event
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// OSFS is the default WritableFS, backed directly by the os package. It's
+// used by FileSink unless WithFS supplies an alternative.
+type OSFS struct{}
+
+// OpenFile implements WritableFS.
+func (OSFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	return os.OpenFile(name, flag, perm)
+}
+
+// MkdirAll implements WritableFS.
+func (OSFS) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+// Chmod implements WritableFS.
+func (OSFS) Chmod(name string, mode os.FileMode) error {
+	return os.Chmod(name, mode)
+}
+
+// Rename implements WritableFS.
+func (OSFS) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+// Remove implements WritableFS.
+func (OSFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+// Stat implements WritableFS.
+func (OSFS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+// Glob implements WritableFS.
+func (OSFS) Glob(pattern string) ([]string, error) {
+	return filepath.Glob(pattern)
+}
+
+// SyncDir implements DirSyncer by opening and fsyncing the named directory,
+// which is needed to make a preceding rename durable.
+func (OSFS) SyncDir(path string) error {
+	d, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
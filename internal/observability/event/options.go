@@ -0,0 +1,211 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package event
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Option is a function that takes in an options struct and sets values, or
+// returns an error if the value isn't valid.
+type Option func(*options) error
+
+// options holds all the configuration options for sinks/formatters in one
+// place, populated via functional options passed to constructors such as
+// NewFileSink.
+type options struct {
+	withFileMode *os.FileMode
+
+	withRotateBytes    int64
+	withRotateDuration time.Duration
+	withMaxFiles       int
+	withRotateSuffix   string
+	withCompress       bool
+
+	withFileLock bool
+
+	withAsyncBufferSize int
+	withAsyncDropPolicy DropPolicy
+	withFsyncOnFlush    bool
+
+	withFS WritableFS
+
+	withAtomicSegments bool
+	withHashChain      string
+}
+
+// getDefaultOptions returns options with their default values.
+func getDefaultOptions() options {
+	return options{}
+}
+
+// getOpts applies each supplied Option and returns the fully configured
+// options, along with any error encountered while applying them.
+func getOpts(opt ...Option) (options, error) {
+	opts := getDefaultOptions()
+	for _, o := range opt {
+		if o == nil {
+			continue
+		}
+		if err := o(&opts); err != nil {
+			return options{}, err
+		}
+	}
+	return opts, nil
+}
+
+// WithFileMode provides an Option to represent a file's mode. Supplying 0
+// tells the FileSink to maintain an existing file's current mode rather than
+// changing it.
+func WithFileMode(mode os.FileMode) Option {
+	return func(o *options) error {
+		o.withFileMode = &mode
+		return nil
+	}
+}
+
+// WithRotateBytes provides an Option to set the size in bytes a FileSink's
+// current log file may reach before it is rotated out. A value <= 0 disables
+// size-based rotation.
+func WithRotateBytes(bytes int64) Option {
+	return func(o *options) error {
+		o.withRotateBytes = bytes
+		return nil
+	}
+}
+
+// WithRotateDuration provides an Option to set how long a FileSink's current
+// log file may remain open before it is rotated out. A value of 0 disables
+// time-based rotation; a negative value is rejected with ErrInvalidParameter.
+func WithRotateDuration(dur time.Duration) Option {
+	return func(o *options) error {
+		if dur < 0 {
+			return fmt.Errorf("rotation duration must not be negative: %w", ErrInvalidParameter)
+		}
+		o.withRotateDuration = dur
+		return nil
+	}
+}
+
+// WithMaxFiles provides an Option to set the maximum number of rotated
+// segments a FileSink keeps around before pruning the oldest. A value <= 0
+// means no segments are ever pruned.
+func WithMaxFiles(max int) Option {
+	return func(o *options) error {
+		o.withMaxFiles = max
+		return nil
+	}
+}
+
+// WithRotateSuffix provides an Option to override the suffix pattern applied
+// to a rotated segment's timestamp. The suffix is passed to time.Format, so
+// it should be a valid reference-time layout. Defaults to
+// "2006-01-02T15-04-05": time.RFC3339 without its zone offset and with colons
+// replaced by dashes, since colons are awkward in file names.
+func WithRotateSuffix(suffix string) Option {
+	return func(o *options) error {
+		if strings.TrimSpace(suffix) == "" {
+			return fmt.Errorf("rotate suffix cannot be empty: %w", ErrInvalidParameter)
+		}
+		o.withRotateSuffix = suffix
+		return nil
+	}
+}
+
+// WithCompress provides an Option to gzip-compress rotated segments in a
+// background goroutine once they've been renamed out of the way.
+func WithCompress(compress bool) Option {
+	return func(o *options) error {
+		o.withCompress = compress
+		return nil
+	}
+}
+
+// WithFileLock provides an Option that makes a FileSink take an OS advisory
+// lock on its file descriptor around each write, so that multiple Vault
+// processes (or an active/standby pair) sharing the same audit path don't
+// interleave writes beyond PIPE_BUF.
+func WithFileLock(enabled bool) Option {
+	return func(o *options) error {
+		o.withFileLock = enabled
+		return nil
+	}
+}
+
+// WithAsyncBuffer provides an Option that makes a FileSink write
+// asynchronously: Process enqueues the formatted event onto a bounded
+// channel of the given size and returns immediately, while a background
+// goroutine drains the channel to disk. policy governs what happens when
+// the channel is full; see DropPolicy. A size <= 0 disables async
+// buffering and restores today's synchronous behavior.
+func WithAsyncBuffer(size int, policy DropPolicy) Option {
+	return func(o *options) error {
+		if size > 0 {
+			if err := policy.validate(); err != nil {
+				return err
+			}
+		}
+		o.withAsyncBufferSize = size
+		o.withAsyncDropPolicy = policy
+		return nil
+	}
+}
+
+// WithFsyncOnFlush provides an Option that makes Flush call fsync on the
+// underlying file once the async write queue has drained, so operators
+// using WithAsyncBuffer can still get a durability guarantee at the points
+// they choose to flush (e.g. on shutdown), trading it away for latency the
+// rest of the time.
+func WithFsyncOnFlush(enabled bool) Option {
+	return func(o *options) error {
+		o.withFsyncOnFlush = enabled
+		return nil
+	}
+}
+
+// WithFS provides an Option to make a FileSink write through fs rather than
+// the real filesystem. Useful for deterministic tests of rotation/reopen
+// behavior against MemFS, or for plugging in an alternative backend.
+// Defaults to OSFS when not supplied.
+func WithFS(fs WritableFS) Option {
+	return func(o *options) error {
+		if fs == nil {
+			return fmt.Errorf("fs cannot be nil: %w", ErrInvalidParameter)
+		}
+		o.withFS = fs
+		return nil
+	}
+}
+
+// WithAtomicSegments provides an Option that makes a FileSink write each
+// event to a temp file in the same directory and rename(2) it into place
+// under a monotonically numbered segment (e.g. audit-000123.log), instead
+// of appending to a single file. Combined with WithHashChain, this gives
+// tamper-evident output that downstream shippers never see partially
+// written.
+func WithAtomicSegments(enabled bool) Option {
+	return func(o *options) error {
+		o.withAtomicSegments = enabled
+		return nil
+	}
+}
+
+// WithHashChain provides an Option that prepends the previous segment's
+// hash into each new segment's header, chaining them together so that
+// removing or reordering a segment is detectable downstream. Requires
+// WithAtomicSegments. algo must be "sha256" or "sha512".
+func WithHashChain(algo string) Option {
+	return func(o *options) error {
+		switch algo {
+		case "sha256", "sha512":
+			o.withHashChain = algo
+			return nil
+		default:
+			return fmt.Errorf("unsupported hash chain algorithm %q: %w", algo, ErrInvalidParameter)
+		}
+	}
+}
@@ -5,34 +5,162 @@ package event
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/hashicorp/eventlogger"
+	"github.com/hashicorp/vault/internal/observability/event/filelock"
 )
 
 // defaultFileMode is the default file permissions (read/write for everyone).
 const (
 	defaultFileMode = 0o600
 	devnull         = "/dev/null"
+
+	// defaultRotateSuffix is the time.Format layout used to name rotated
+	// segments when WithRotateSuffix isn't supplied. It deliberately omits
+	// the zone offset: "Z07:00" with the colon replaced by a dash (to keep colons
+	// out of file names, notably on Windows) is no longer a valid zone
+	// layout token and silently formats wrong (e.g. "+01:30" becomes
+	// "+01-00", and UTC becomes a bogus "Z-00"). Segment names are already
+	// disambiguated with a numeric suffix on collision, so a bare local
+	// timestamp is sufficient here.
+	defaultRotateSuffix = "2006-01-02T15-04-05"
 )
 
+// DropPolicy governs what a FileSink configured with WithAsyncBuffer does
+// when its write queue is full.
+type DropPolicy int
+
+const (
+	// BlockOnFull makes Process block until there's room in the queue,
+	// preserving today's synchronous backpressure at the cost of no longer
+	// guaranteeing Process returns immediately.
+	BlockOnFull DropPolicy = iota
+	// DropNewest discards the event that was about to be enqueued.
+	DropNewest
+	// DropOldest discards the oldest queued event to make room for the one
+	// being enqueued.
+	DropOldest
+)
+
+// validate reports whether d is one of the known DropPolicy values.
+func (d DropPolicy) validate() error {
+	switch d {
+	case BlockOnFull, DropNewest, DropOldest:
+		return nil
+	default:
+		return fmt.Errorf("unknown drop policy %d: %w", d, ErrInvalidParameter)
+	}
+}
+
+// Stats reports counters for a FileSink configured with WithAsyncBuffer.
+type Stats struct {
+	// Enqueued is the number of events successfully placed on the write
+	// queue.
+	Enqueued uint64
+	// Written is the number of events the background writer has
+	// successfully flushed to disk.
+	Written uint64
+	// Dropped is the number of events discarded under DropNewest/DropOldest,
+	// or that failed to write.
+	Dropped uint64
+	// QueueDepth is the number of events currently queued, awaiting write.
+	QueueDepth int
+}
+
 // FileSink is a sink node which handles writing events to file.
 type FileSink struct {
-	file           *os.File
+	file           File
+	fs             WritableFS
 	fileLock       sync.RWMutex
 	fileMode       os.FileMode
 	path           string
 	requiredFormat string
+
+	// rotateBytes is the file size, in bytes, at which the current log file
+	// is rotated out. 0 disables size-based rotation.
+	rotateBytes int64
+	// rotateDuration is how long the current log file may remain open
+	// before it's rotated out. 0 disables time-based rotation.
+	rotateDuration time.Duration
+	// maxFiles is the number of rotated segments to retain before the
+	// oldest is pruned. 0 means segments are never pruned.
+	maxFiles int
+	// rotateSuffix is the time.Format layout used to build a rotated
+	// segment's file name suffix.
+	rotateSuffix string
+	// compress, when true, gzip-compresses a rotated segment in a
+	// background goroutine once it's been renamed out of the way.
+	compress bool
+	// compressingMu guards compressing.
+	compressingMu sync.Mutex
+	// compressing tracks segment paths currently being compressed in the
+	// background, so pruneSegments can avoid removing one out from under
+	// compressSegment.
+	compressing map[string]struct{}
+
+	// curSize is the size, in bytes, written to the currently open file.
+	curSize int64
+	// openedAt is when the currently open file was opened, used to decide
+	// whether rotateDuration has elapsed.
+	openedAt time.Time
+
+	// advisoryLock, when true, makes the sink take an OS advisory lock on
+	// its file descriptor around each write via the filelock package, so
+	// that separate processes sharing the same path don't interleave
+	// writes.
+	advisoryLock bool
+
+	// asyncQueue, when non-nil, makes Process enqueue formatted events here
+	// instead of writing them synchronously; a background goroutine started
+	// in NewFileSink drains it. nil means async buffering is disabled (the
+	// default), matching today's synchronous behavior.
+	asyncQueue   chan []byte
+	asyncPolicy  DropPolicy
+	asyncWG      sync.WaitGroup
+	fsyncOnFlush bool
+
+	enqueued uint64
+	written  uint64
+	dropped  uint64
+
+	// atomicSegments, when true, makes log write each event to its own
+	// write-and-rename segment file rather than appending to a single
+	// continuously open file.
+	atomicSegments bool
+	// hashChainAlgo, when non-empty, chains each atomic segment to the
+	// previous one by hash, using the named algorithm ("sha256"/"sha512").
+	hashChainAlgo string
+	// segmentSeq is the next monotonic segment number to use when
+	// atomicSegments is enabled.
+	segmentSeq uint64
+	// lastSegmentHash is the hash of the most recently written segment,
+	// prepended into the next segment's header when hashChainAlgo is set.
+	lastSegmentHash []byte
 }
 
 // NewFileSink should be used to create a new FileSink.
-// Accepted options: WithFileMode.
+// Accepted options: WithFileMode, WithRotateBytes, WithRotateDuration,
+// WithMaxFiles, WithRotateSuffix, WithCompress, WithFileLock,
+// WithAsyncBuffer, WithFsyncOnFlush, WithFS, WithAtomicSegments,
+// WithHashChain. WithRotateBytes, WithRotateDuration, WithMaxFiles,
+// WithCompress, and WithFileLock are rejected together with
+// WithAtomicSegments: atomic-segment writes don't go through the
+// rotate/compress/prune/advisory-lock path those options configure.
 func NewFileSink(path string, format string, opt ...Option) (*FileSink, error) {
 	const op = "event.NewFileSink"
 
@@ -47,6 +175,35 @@ func NewFileSink(path string, format string, opt ...Option) (*FileSink, error) {
 		return nil, fmt.Errorf("%s: error applying options: %w", op, err)
 	}
 
+	if opts.withHashChain != "" && !opts.withAtomicSegments {
+		return nil, fmt.Errorf("%s: WithHashChain requires WithAtomicSegments: %w", op, ErrInvalidParameter)
+	}
+
+	// WithAtomicSegments writes each event through logAtomicSegment instead
+	// of the rotate/compress/prune/advisory-lock path log otherwise takes,
+	// so none of those options do anything under it. Rather than silently
+	// ignoring them (and an operator believing they got cross-process
+	// locking or pruning they didn't), reject the combination outright.
+	if opts.withAtomicSegments {
+		switch {
+		case opts.withRotateBytes > 0:
+			return nil, fmt.Errorf("%s: WithRotateBytes is not supported with WithAtomicSegments: %w", op, ErrInvalidParameter)
+		case opts.withRotateDuration > 0:
+			return nil, fmt.Errorf("%s: WithRotateDuration is not supported with WithAtomicSegments: %w", op, ErrInvalidParameter)
+		case opts.withMaxFiles > 0:
+			return nil, fmt.Errorf("%s: WithMaxFiles is not supported with WithAtomicSegments: %w", op, ErrInvalidParameter)
+		case opts.withCompress:
+			return nil, fmt.Errorf("%s: WithCompress is not supported with WithAtomicSegments: %w", op, ErrInvalidParameter)
+		case opts.withFileLock:
+			return nil, fmt.Errorf("%s: WithFileLock is not supported with WithAtomicSegments: %w", op, ErrInvalidParameter)
+		}
+	}
+
+	fs := opts.withFS
+	if fs == nil {
+		fs = OSFS{}
+	}
+
 	mode := os.FileMode(defaultFileMode)
 	// If we got an optional file mode supplied and our path isn't a special keyword
 	// then we should use the supplied file mode, or maintain the existing file mode.
@@ -54,7 +211,7 @@ func NewFileSink(path string, format string, opt ...Option) (*FileSink, error) {
 	case path == devnull:
 	case opts.withFileMode == nil:
 	case *opts.withFileMode == 0: // Maintain the existing file's mode when set to "0000".
-		fileInfo, err := os.Stat(path)
+		fileInfo, err := fs.Stat(path)
 		if err != nil {
 			return nil, fmt.Errorf("%s: unable to determine existing file mode: %w", op, err)
 		}
@@ -63,19 +220,58 @@ func NewFileSink(path string, format string, opt ...Option) (*FileSink, error) {
 		mode = *opts.withFileMode
 	}
 
+	rotateSuffix := opts.withRotateSuffix
+	if rotateSuffix == "" {
+		rotateSuffix = defaultRotateSuffix
+	}
+
 	sink := &FileSink{
 		file:           nil,
+		fs:             fs,
 		fileLock:       sync.RWMutex{},
 		fileMode:       mode,
 		requiredFormat: format,
 		path:           p,
+		rotateBytes:    opts.withRotateBytes,
+		rotateDuration: opts.withRotateDuration,
+		maxFiles:       opts.withMaxFiles,
+		rotateSuffix:   rotateSuffix,
+		compress:       opts.withCompress,
+		advisoryLock:   opts.withFileLock,
+		fsyncOnFlush:   opts.withFsyncOnFlush,
+		atomicSegments: opts.withAtomicSegments,
+		hashChainAlgo:  opts.withHashChain,
 	}
 
-	// Ensure that the file can be successfully opened for writing;
-	// otherwise it will be too late to catch later without problems
+	// Ensure that the sink can actually write; otherwise it will be too
+	// late to catch later without problems
 	// (ref: https://github.com/hashicorp/vault/issues/550)
-	if err := sink.open(); err != nil {
-		return nil, fmt.Errorf("%s: sanity check failed; unable to open %q for writing: %w", op, path, err)
+	switch {
+	case sink.atomicSegments:
+		if err := fs.MkdirAll(filepath.Dir(p), mode); err != nil {
+			return nil, fmt.Errorf("%s: sanity check failed; unable to create directory for %q: %w", op, path, err)
+		}
+
+		// Resume from any segments a previous run of this process (restart,
+		// upgrade, unseal cycle) already left behind, rather than starting
+		// back at segment 0 and overwriting them, and rather than silently
+		// restarting the hash chain from nil.
+		seq, lastHash, err := sink.resumeSegments()
+		if err != nil {
+			return nil, fmt.Errorf("%s: unable to resume existing segments for %q: %w", op, path, err)
+		}
+		sink.segmentSeq = seq
+		sink.lastSegmentHash = lastHash
+	default:
+		if err := sink.open(); err != nil {
+			return nil, fmt.Errorf("%s: sanity check failed; unable to open %q for writing: %w", op, path, err)
+		}
+	}
+
+	if opts.withAsyncBufferSize > 0 {
+		sink.asyncQueue = make(chan []byte, opts.withAsyncBufferSize)
+		sink.asyncPolicy = opts.withAsyncDropPolicy
+		go sink.asyncWriteLoop()
 	}
 
 	return sink, nil
@@ -105,6 +301,12 @@ func (f *FileSink) Process(ctx context.Context, e *eventlogger.Event) (*eventlog
 		return nil, fmt.Errorf("%s: unable to retrieve event formatted as %q", op, f.requiredFormat)
 	}
 
+	if f.asyncQueue != nil {
+		f.enqueue(formatted)
+		// return nil for the event to indicate the pipeline is complete.
+		return nil, nil
+	}
+
 	err := f.log(formatted)
 	if err != nil {
 		return nil, fmt.Errorf("%s: error writing file for sink: %w", op, err)
@@ -114,6 +316,130 @@ func (f *FileSink) Process(ctx context.Context, e *eventlogger.Event) (*eventlog
 	return nil, nil
 }
 
+// enqueue places data on the async write queue, applying the sink's
+// DropPolicy if the queue is full. It never blocks under DropNewest or
+// DropOldest; under BlockOnFull it blocks until room is available.
+//
+// Every non-blocking send below calls asyncWG.Add before attempting the
+// send rather than after: asyncWriteLoop is already running concurrently,
+// so a send that completes can be picked up and have its Done called by the
+// writer before the sending goroutine gets scheduled again, and Add must
+// happen-before the matching Done or the WaitGroup's counter can
+// momentarily go negative and panic.
+func (f *FileSink) enqueue(data []byte) {
+	if f.asyncPolicy == DropOldest {
+		for {
+			f.asyncWG.Add(1)
+			select {
+			case f.asyncQueue <- data:
+				atomic.AddUint64(&f.enqueued, 1)
+				return
+			default:
+				f.asyncWG.Done()
+			}
+
+			// Queue is full: drop the oldest queued event to make room and
+			// loop back to retry the non-blocking send. Both selects here
+			// are non-blocking, so a concurrent producer winning the race to
+			// refill the slot we just freed (or the writer goroutine
+			// draining it first) just means we loop and try again, rather
+			// than falling through to a blocking send the way BlockOnFull
+			// does.
+			select {
+			case <-f.asyncQueue:
+				f.asyncWG.Done()
+				atomic.AddUint64(&f.dropped, 1)
+			default:
+			}
+		}
+	}
+
+	if f.asyncPolicy == DropNewest {
+		f.asyncWG.Add(1)
+		select {
+		case f.asyncQueue <- data:
+			atomic.AddUint64(&f.enqueued, 1)
+		default:
+			f.asyncWG.Done()
+			atomic.AddUint64(&f.dropped, 1)
+		}
+		return
+	}
+
+	f.asyncWG.Add(1)
+	f.asyncQueue <- data
+	atomic.AddUint64(&f.enqueued, 1)
+}
+
+// asyncWriteLoop drains the async write queue to disk. It runs for the
+// lifetime of the sink once started in NewFileSink.
+func (f *FileSink) asyncWriteLoop() {
+	for data := range f.asyncQueue {
+		if err := f.log(data); err != nil {
+			atomic.AddUint64(&f.dropped, 1)
+		} else {
+			atomic.AddUint64(&f.written, 1)
+		}
+		f.asyncWG.Done()
+	}
+}
+
+// Stats reports counters for a FileSink configured with WithAsyncBuffer. It
+// returns a zero Stats if async buffering isn't enabled.
+func (f *FileSink) Stats() Stats {
+	if f.asyncQueue == nil {
+		return Stats{}
+	}
+
+	return Stats{
+		Enqueued:   atomic.LoadUint64(&f.enqueued),
+		Written:    atomic.LoadUint64(&f.written),
+		Dropped:    atomic.LoadUint64(&f.dropped),
+		QueueDepth: len(f.asyncQueue),
+	}
+}
+
+// Flush waits for the async write queue to drain, so callers (typically
+// during shutdown) can be sure every event Process accepted has been
+// written before moving on. It's a no-op if async buffering isn't enabled.
+// If WithFsyncOnFlush was supplied, it fsyncs the underlying file once the
+// queue is empty.
+func (f *FileSink) Flush(ctx context.Context) error {
+	const op = "event.(FileSink).Flush"
+
+	if f.asyncQueue == nil {
+		return nil
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		f.asyncWG.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if !f.fsyncOnFlush {
+		return nil
+	}
+
+	f.fileLock.RLock()
+	defer f.fileLock.RUnlock()
+
+	if f.file == nil {
+		return nil
+	}
+	if err := f.file.Sync(); err != nil {
+		return fmt.Errorf("%s: unable to fsync file for sink: %w", op, err)
+	}
+
+	return nil
+}
+
 // Reopen handles closing and reopening the file.
 func (f *FileSink) Reopen() error {
 	const op = "event.(FileSink).Reopen"
@@ -123,6 +449,12 @@ func (f *FileSink) Reopen() error {
 		return nil
 	}
 
+	// In atomic segments mode there's no long-lived file descriptor to
+	// reopen: every event already gets its own write-and-rename segment.
+	if f.atomicSegments {
+		return nil
+	}
+
 	f.fileLock.Lock()
 	defer f.fileLock.Unlock()
 
@@ -156,12 +488,12 @@ func (f *FileSink) open() error {
 		return nil
 	}
 
-	if err := os.MkdirAll(filepath.Dir(f.path), f.fileMode); err != nil {
+	if err := f.fs.MkdirAll(filepath.Dir(f.path), f.fileMode); err != nil {
 		return fmt.Errorf("%s: unable to create file %q: %w", op, f.path, err)
 	}
 
 	var err error
-	f.file, err = os.OpenFile(f.path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, f.fileMode)
+	f.file, err = f.fs.OpenFile(f.path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, f.fileMode)
 	if err != nil {
 		return fmt.Errorf("%s: unable to open file for sink: %w", op, err)
 	}
@@ -172,16 +504,384 @@ func (f *FileSink) open() error {
 	case devnull:
 	default:
 		if f.fileMode != 0 {
-			err = os.Chmod(f.path, f.fileMode)
+			err = f.fs.Chmod(f.path, f.fileMode)
 			if err != nil {
 				return fmt.Errorf("%s: unable to change file %q permissions '%v' for sink: %w", op, f.path, f.fileMode, err)
 			}
 		}
 	}
 
+	f.openedAt = time.Now()
+	f.curSize = 0
+	if info, err := f.file.Stat(); err == nil {
+		f.curSize = info.Size()
+	}
+
+	if f.advisoryLock {
+		// Take and immediately release the lock as a sanity check, so a
+		// file that's incompatible with advisory locking (e.g. on a
+		// filesystem that doesn't support it) is caught here rather than
+		// on the first write.
+		if err := f.withAdvisoryLock(func() error { return nil }); err != nil {
+			return fmt.Errorf("%s: unable to acquire advisory lock on %q: %w", op, f.path, err)
+		}
+	}
+
 	return nil
 }
 
+// withAdvisoryLock runs fn while holding an OS advisory lock on the
+// currently open file, if WithFileLock was supplied; otherwise it just runs
+// fn. It assumes fileLock is already held and that a file is open. Advisory
+// locking only applies when the sink's WritableFS hands back a real
+// *os.File (i.e. OSFS); other backends such as MemFS are single-process by
+// construction, so locking is skipped for them.
+func (f *FileSink) withAdvisoryLock(fn func() error) error {
+	if !f.advisoryLock {
+		return fn()
+	}
+
+	osFile, ok := f.file.(*os.File)
+	if !ok {
+		return fn()
+	}
+
+	lf := &filelock.File{File: osFile}
+	if err := lf.Lock(); err != nil {
+		return fmt.Errorf("unable to acquire advisory lock: %w", err)
+	}
+	defer lf.Unlock()
+
+	return fn()
+}
+
+// rotateIfNeeded checks whether writing nextWrite more bytes would take the
+// currently open file beyond rotateBytes, or whether it has been open for at
+// least rotateDuration, rotating it out if so. It assumes fileLock is already held for writing and that a file is
+// already open.
+func (f *FileSink) rotateIfNeeded(nextWrite int64) error {
+	const op = "event.(FileSink).rotateIfNeeded"
+
+	if f.rotateBytes <= 0 && f.rotateDuration <= 0 {
+		return nil
+	}
+
+	needsRotation := (f.rotateBytes > 0 && f.curSize+nextWrite > f.rotateBytes) ||
+		(f.rotateDuration > 0 && time.Since(f.openedAt) >= f.rotateDuration)
+	if !needsRotation {
+		return nil
+	}
+
+	if err := f.rotate(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// rotate closes the currently open file, renames it aside using a
+// timestamped suffix, prunes segments beyond maxFiles, and opens a fresh
+// file in its place. It assumes fileLock is already held for writing.
+func (f *FileSink) rotate() error {
+	const op = "event.(FileSink).rotate"
+
+	if f.file != nil {
+		if err := f.file.Close(); err != nil {
+			return fmt.Errorf("%s: unable to close file for rotation: %w", op, err)
+		}
+		f.file = nil
+	}
+
+	if _, err := f.fs.Stat(f.path); err != nil {
+		if os.IsNotExist(err) {
+			// Nothing to rotate out; just (re)open a fresh file.
+			return f.open()
+		}
+		return fmt.Errorf("%s: unable to stat file for rotation: %w", op, err)
+	}
+
+	rotated := f.path + "." + time.Now().Format(f.rotateSuffix)
+	for n := 1; ; n++ {
+		if _, err := f.fs.Stat(rotated); os.IsNotExist(err) {
+			break
+		}
+		rotated = fmt.Sprintf("%s.%s.%d", f.path, time.Now().Format(f.rotateSuffix), n)
+	}
+
+	if err := f.fs.Rename(f.path, rotated); err != nil {
+		return fmt.Errorf("%s: unable to rename %q to %q for rotation: %w", op, f.path, rotated, err)
+	}
+
+	if f.compress {
+		// compressSegment writes to path+".gz" before removing path itself,
+		// so both names need to be protected from a concurrent prune pass
+		// for the whole time compression is in flight.
+		gzPath := rotated + ".gz"
+		f.markCompressing(rotated)
+		f.markCompressing(gzPath)
+		go func(path, gzPath string) {
+			defer f.unmarkCompressing(path)
+			defer f.unmarkCompressing(gzPath)
+			f.compressSegment(path)
+		}(rotated, gzPath)
+	}
+
+	if f.maxFiles > 0 {
+		if err := f.pruneSegments(f.path, f.maxFiles); err != nil {
+			return fmt.Errorf("%s: unable to prune rotated segments: %w", op, err)
+		}
+	}
+
+	return f.open()
+}
+
+// markCompressing records that path is being compressed in the background,
+// so a concurrent pruneSegments call knows to leave it alone rather than
+// removing it out from under compressSegment.
+func (f *FileSink) markCompressing(path string) {
+	f.compressingMu.Lock()
+	defer f.compressingMu.Unlock()
+
+	if f.compressing == nil {
+		f.compressing = make(map[string]struct{})
+	}
+	f.compressing[path] = struct{}{}
+}
+
+// unmarkCompressing clears a path recorded by markCompressing once
+// compression (successful or not) has finished.
+func (f *FileSink) unmarkCompressing(path string) {
+	f.compressingMu.Lock()
+	defer f.compressingMu.Unlock()
+
+	delete(f.compressing, path)
+}
+
+// isCompressing reports whether path is currently being compressed in the
+// background.
+func (f *FileSink) isCompressing(path string) bool {
+	f.compressingMu.Lock()
+	defer f.compressingMu.Unlock()
+
+	_, ok := f.compressing[path]
+	return ok
+}
+
+// compressSegment gzip-compresses the file at path into path+".gz" and
+// removes the uncompressed original. It's intended to run in its own
+// goroutine since rotation must not block the request path on compression.
+func (f *FileSink) compressSegment(path string) {
+	src, err := f.fs.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return
+	}
+	defer src.Close()
+
+	dstPath := path + ".gz"
+	dst, err := f.fs.OpenFile(dstPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, defaultFileMode)
+	if err != nil {
+		return
+	}
+
+	gw := gzip.NewWriter(dst)
+	if _, err := io.Copy(gw, src); err != nil {
+		gw.Close()
+		dst.Close()
+		f.fs.Remove(dstPath)
+		return
+	}
+	if err := gw.Close(); err != nil {
+		dst.Close()
+		f.fs.Remove(dstPath)
+		return
+	}
+	if err := dst.Close(); err != nil {
+		f.fs.Remove(dstPath)
+		return
+	}
+
+	f.fs.Remove(path)
+}
+
+// pruneSegments removes the oldest rotated segments for base beyond keep,
+// determined by lexical ordering of their timestamp suffix (oldest first).
+// Segments still being compressed in the background are left alone; a later
+// rotation's prune pass will catch them once compression has finished and
+// they've been replaced by their .gz counterpart.
+func (f *FileSink) pruneSegments(base string, keep int) error {
+	matches, err := f.fs.Glob(base + ".*")
+	if err != nil {
+		return err
+	}
+	if len(matches) <= keep {
+		return nil
+	}
+
+	sort.Strings(matches)
+
+	for _, m := range matches[:len(matches)-keep] {
+		if f.isCompressing(m) {
+			continue
+		}
+		if err := f.fs.Remove(m); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// logAtomicSegment writes data to a temp file in the same directory as
+// path and rename(2)s it into place under a monotonically numbered segment
+// name (e.g. audit-000123.log), fsyncing both the file and its parent
+// directory before the rename so downstream shippers never observe a
+// partially written segment, and fsyncing the directory again after the
+// rename so the rename itself is durable. It assumes fileLock is already held.
+//
+// If hashChainAlgo is set, the previous segment's hash is prepended as a
+// header line, so each segment commits to the one before it.
+func (f *FileSink) logAtomicSegment(data []byte) error {
+	const op = "event.(FileSink).logAtomicSegment"
+
+	dir := filepath.Dir(f.path)
+	if err := f.fs.MkdirAll(dir, f.fileMode); err != nil {
+		return fmt.Errorf("unable to create directory %q: %w", dir, err)
+	}
+
+	payload := data
+	if f.hashChainAlgo != "" {
+		header := fmt.Sprintf("# prev-segment-hash: %s:%s\n", f.hashChainAlgo, hex.EncodeToString(f.lastSegmentHash))
+		payload = append([]byte(header), data...)
+	}
+
+	tmpPath := fmt.Sprintf("%s.tmp-%06d", f.path, f.segmentSeq)
+	tmp, err := f.fs.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.fileMode)
+	if err != nil {
+		return fmt.Errorf("unable to open temp segment %q: %w", tmpPath, err)
+	}
+
+	if _, err := tmp.Write(payload); err != nil {
+		tmp.Close()
+		f.fs.Remove(tmpPath)
+		return fmt.Errorf("unable to write temp segment %q: %w", tmpPath, err)
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		f.fs.Remove(tmpPath)
+		return fmt.Errorf("unable to fsync temp segment %q: %w", tmpPath, err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		f.fs.Remove(tmpPath)
+		return fmt.Errorf("unable to close temp segment %q: %w", tmpPath, err)
+	}
+
+	if err := f.syncDir(dir); err != nil {
+		f.fs.Remove(tmpPath)
+		return fmt.Errorf("unable to fsync directory %q: %w", dir, err)
+	}
+
+	segPath := f.segmentPath(dir, f.segmentSeq)
+	if err := f.fs.Rename(tmpPath, segPath); err != nil {
+		return fmt.Errorf("unable to rename temp segment %q to %q: %w", tmpPath, segPath, err)
+	}
+
+	if err := f.syncDir(dir); err != nil {
+		return fmt.Errorf("unable to fsync directory %q: %w", dir, err)
+	}
+
+	if f.hashChainAlgo != "" {
+		f.lastSegmentHash = hashChainSum(f.hashChainAlgo, payload)
+	}
+	f.segmentSeq++
+
+	return nil
+}
+
+// segmentPath builds the path for segment n of an atomic-segments sink,
+// e.g. "/var/log/audit.log" with n=123 becomes "/var/log/audit-000123.log".
+func (f *FileSink) segmentPath(dir string, n uint64) string {
+	base := filepath.Base(f.path)
+	ext := filepath.Ext(base)
+	base = strings.TrimSuffix(base, ext)
+	return filepath.Join(dir, fmt.Sprintf("%s-%06d%s", base, n, ext))
+}
+
+// resumeSegments inspects the sink's directory for existing atomic segments
+// matching "<base>-NNNNNN<ext>" and returns the sequence number to continue
+// from and, if hashChainAlgo is set, the hash of the most recently written
+// segment. This lets a FileSink restarted against a path with segments
+// already on it (process restart, upgrade, unseal cycle) continue the
+// sequence and the hash chain instead of starting back at 0 and silently
+// overwriting prior segments via rename.
+func (f *FileSink) resumeSegments() (uint64, []byte, error) {
+	dir := filepath.Dir(f.path)
+	base := filepath.Base(f.path)
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+
+	matches, err := f.fs.Glob(filepath.Join(dir, fmt.Sprintf("%s-*%s", stem, ext)))
+	if err != nil {
+		return 0, nil, fmt.Errorf("unable to list existing segments: %w", err)
+	}
+	if len(matches) == 0 {
+		return 0, nil, nil
+	}
+
+	// Segment suffixes are fixed-width zero-padded numbers, so lexical and
+	// numeric order agree.
+	sort.Strings(matches)
+	latest := matches[len(matches)-1]
+
+	suffix := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(latest), stem+"-"), ext)
+	seq, err := strconv.ParseUint(suffix, 10, 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("unable to parse segment sequence from %q: %w", latest, err)
+	}
+
+	if f.hashChainAlgo == "" {
+		return seq + 1, nil, nil
+	}
+
+	latestFile, err := f.fs.OpenFile(latest, os.O_RDONLY, 0)
+	if err != nil {
+		return 0, nil, fmt.Errorf("unable to open latest segment %q: %w", latest, err)
+	}
+	defer latestFile.Close()
+
+	content, err := io.ReadAll(latestFile)
+	if err != nil {
+		return 0, nil, fmt.Errorf("unable to read latest segment %q: %w", latest, err)
+	}
+
+	return seq + 1, hashChainSum(f.hashChainAlgo, content), nil
+}
+
+// syncDir fsyncs dir if the sink's WritableFS supports it, making a
+// preceding rename durable. It's a no-op for backends like MemFS that have
+// no on-disk directory entries.
+func (f *FileSink) syncDir(dir string) error {
+	syncer, ok := f.fs.(DirSyncer)
+	if !ok {
+		return nil
+	}
+	return syncer.SyncDir(dir)
+}
+
+// hashChainSum hashes data with the named algorithm ("sha256" or
+// "sha512"), both of which are validated at option-parsing time.
+func hashChainSum(algo string, data []byte) []byte {
+	switch algo {
+	case "sha512":
+		sum := sha512.Sum512(data)
+		return sum[:]
+	default: // "sha256"
+		sum := sha256.Sum256(data)
+		return sum[:]
+	}
+}
+
 // log writes the buffer to the file.
 // It acquires a lock on the file to do this.
 func (f *FileSink) log(data []byte) error {
@@ -190,13 +890,29 @@ func (f *FileSink) log(data []byte) error {
 	f.fileLock.Lock()
 	defer f.fileLock.Unlock()
 
+	if f.atomicSegments {
+		if err := f.logAtomicSegment(data); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		return nil
+	}
+
 	reader := bytes.NewReader(data)
 
 	if err := f.open(); err != nil {
 		return fmt.Errorf("%s: unable to open file for sink: %w", op, err)
 	}
 
-	if _, err := reader.WriteTo(f.file); err == nil {
+	if err := f.rotateIfNeeded(int64(len(data))); err != nil {
+		return fmt.Errorf("%s: unable to rotate file for sink: %w", op, err)
+	}
+
+	writeErr := f.withAdvisoryLock(func() error {
+		n, err := reader.WriteTo(f.file)
+		f.curSize += n
+		return err
+	})
+	if writeErr == nil {
 		return nil
 	}
 
@@ -217,8 +933,11 @@ func (f *FileSink) log(data []byte) error {
 		return fmt.Errorf("%s: unable to seek to start of file for sink: %w", op, err)
 	}
 
-	_, err = reader.WriteTo(f.file)
-	if err != nil {
+	if err := f.withAdvisoryLock(func() error {
+		n, err := reader.WriteTo(f.file)
+		f.curSize += n
+		return err
+	}); err != nil {
 		return fmt.Errorf("%s: unable to re-write to file for sink: %w", op, err)
 	}
 
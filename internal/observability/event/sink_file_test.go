@@ -0,0 +1,465 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package event
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// readMemFile reads the full contents of path from fs via the WritableFS
+// interface, so tests don't need to reach into MemFS's unexported fields.
+func readMemFile(t *testing.T, fs *MemFS, path string) []byte {
+	t.Helper()
+
+	f, err := fs.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("OpenFile(%s): %v", path, err)
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("ReadAll(%s): %v", path, err)
+	}
+	return data
+}
+
+func TestFileSink_RotateByBytes(t *testing.T) {
+	fs := NewMemFS()
+	path := "/var/log/audit.log"
+
+	sink, err := NewFileSink(path, "json", WithFS(fs), WithRotateBytes(10))
+	if err != nil {
+		t.Fatalf("NewFileSink: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := sink.log([]byte("0123456789")); err != nil {
+			t.Fatalf("log: %v", err)
+		}
+	}
+
+	matches, err := fs.Glob(path + ".*")
+	if err != nil {
+		t.Fatalf("Glob: %v", err)
+	}
+	if len(matches) != 2 {
+		t.Fatalf("expected 2 rotated segments, got %d: %v", len(matches), matches)
+	}
+
+	info, err := fs.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Size() != 10 {
+		t.Fatalf("expected current file to hold the most recent 10-byte write, got %d bytes", info.Size())
+	}
+}
+
+func TestFileSink_RotateByDuration(t *testing.T) {
+	fs := NewMemFS()
+	path := "/var/log/audit.log"
+
+	sink, err := NewFileSink(path, "json", WithFS(fs), WithRotateDuration(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewFileSink: %v", err)
+	}
+
+	if err := sink.log([]byte("first\n")); err != nil {
+		t.Fatalf("log: %v", err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	if err := sink.log([]byte("second\n")); err != nil {
+		t.Fatalf("log: %v", err)
+	}
+
+	matches, err := fs.Glob(path + ".*")
+	if err != nil {
+		t.Fatalf("Glob: %v", err)
+	}
+	if len(matches) != 1 {
+		t.Fatalf("expected 1 rotated segment once rotateDuration elapsed, got %d: %v", len(matches), matches)
+	}
+}
+
+// TestFileSink_PruneSegments_SkipsInFlightCompression checks that
+// pruneSegments leaves both the original rotated segment and its
+// in-progress ".gz" destination alone while compressSegment is still
+// writing it, rather than only protecting the original. compressSegment
+// writes the ".gz" file before removing the original, so both names are
+// live candidates in pruneSegments' glob during that window.
+func TestFileSink_PruneSegments_SkipsInFlightCompression(t *testing.T) {
+	fs := NewMemFS()
+	base := "/var/log/audit.log"
+
+	sink, err := NewFileSink(base, "json", WithFS(fs), WithCompress(true), WithMaxFiles(1))
+	if err != nil {
+		t.Fatalf("NewFileSink: %v", err)
+	}
+
+	older := base + ".2020-01-01T00-00-00"
+	newer := base + ".2020-01-02T00-00-00"
+	gz := older + ".gz"
+	for _, p := range []string{older, newer, gz} {
+		f, err := fs.OpenFile(p, os.O_WRONLY|os.O_CREATE, 0o600)
+		if err != nil {
+			t.Fatalf("OpenFile(%s): %v", p, err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatalf("Close(%s): %v", p, err)
+		}
+	}
+
+	sink.markCompressing(older)
+	sink.markCompressing(gz)
+
+	if err := sink.pruneSegments(base, 1); err != nil {
+		t.Fatalf("pruneSegments: %v", err)
+	}
+
+	for _, p := range []string{older, gz} {
+		if _, err := fs.Stat(p); err != nil {
+			t.Fatalf("expected %q to survive pruning while marked as compressing, got err=%v", p, err)
+		}
+	}
+}
+
+// TestFileSink_FileLock_RoundTrip exercises WithFileLock against a real
+// file on disk: MemFS has no file descriptors to lock, so advisory locking
+// can only be meaningfully tested through OSFS.
+func TestFileSink_FileLock_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+
+	sink, err := NewFileSink(path, "json", WithFileLock(true))
+	if err != nil {
+		t.Fatalf("NewFileSink: %v", err)
+	}
+
+	if err := sink.log([]byte("hello\n")); err != nil {
+		t.Fatalf("log: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if string(data) != "hello\n" {
+		t.Fatalf("unexpected file contents: %q", data)
+	}
+}
+
+// TestFileSink_AsyncBuffer_BlockOnFull checks that under BlockOnFull every
+// enqueue call is eventually accounted for and nothing is dropped, even
+// when the queue is smaller than the number of events offered to it.
+func TestFileSink_AsyncBuffer_BlockOnFull(t *testing.T) {
+	fs := NewMemFS()
+	sink, err := NewFileSink("/var/log/audit.log", "json", WithFS(fs), WithAsyncBuffer(2, BlockOnFull))
+	if err != nil {
+		t.Fatalf("NewFileSink: %v", err)
+	}
+
+	const n = 10
+	for i := 0; i < n; i++ {
+		sink.enqueue([]byte("x"))
+	}
+
+	if err := sink.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	stats := sink.Stats()
+	if stats.Enqueued != n {
+		t.Fatalf("expected all %d events enqueued under BlockOnFull, got %d", n, stats.Enqueued)
+	}
+	if stats.Dropped != 0 {
+		t.Fatalf("expected no drops under BlockOnFull, got %d", stats.Dropped)
+	}
+	if stats.Written != n {
+		t.Fatalf("expected all %d events written after Flush, got %d", n, stats.Written)
+	}
+}
+
+// TestFileSink_AsyncBuffer_DropPolicies checks that DropNewest and
+// DropOldest never lose track of an event once the queue has drained.
+//
+// The two policies account for drops differently: DropNewest rejects an
+// event before it's ever placed on the queue, so Enqueued+Dropped caps out
+// at the number offered. DropOldest always places the new event by evicting
+// an older, already-Enqueued one, so every offered event is eventually
+// Enqueued; Dropped instead counts evictions on top of that, and the
+// invariant that holds is that every Enqueued event is eventually either
+// Written or Dropped.
+func TestFileSink_AsyncBuffer_DropPolicies(t *testing.T) {
+	const n = 20
+
+	t.Run("DropNewest", func(t *testing.T) {
+		fs := NewMemFS()
+		sink, err := NewFileSink("/var/log/audit.log", "json", WithFS(fs), WithAsyncBuffer(1, DropNewest))
+		if err != nil {
+			t.Fatalf("NewFileSink: %v", err)
+		}
+
+		for i := 0; i < n; i++ {
+			sink.enqueue([]byte("x"))
+		}
+
+		if err := sink.Flush(context.Background()); err != nil {
+			t.Fatalf("Flush: %v", err)
+		}
+
+		stats := sink.Stats()
+		if got := stats.Enqueued + stats.Dropped; got != n {
+			t.Fatalf("expected every offered event to be enqueued or dropped, got enqueued=%d dropped=%d (sum %d) want %d",
+				stats.Enqueued, stats.Dropped, got, n)
+		}
+		if stats.Written != stats.Enqueued {
+			t.Fatalf("expected every enqueued event to be written after Flush, got written=%d enqueued=%d", stats.Written, stats.Enqueued)
+		}
+	})
+
+	t.Run("DropOldest", func(t *testing.T) {
+		fs := NewMemFS()
+		sink, err := NewFileSink("/var/log/audit.log", "json", WithFS(fs), WithAsyncBuffer(1, DropOldest))
+		if err != nil {
+			t.Fatalf("NewFileSink: %v", err)
+		}
+
+		for i := 0; i < n; i++ {
+			sink.enqueue([]byte("x"))
+		}
+
+		if err := sink.Flush(context.Background()); err != nil {
+			t.Fatalf("Flush: %v", err)
+		}
+
+		stats := sink.Stats()
+		if stats.Enqueued != n {
+			t.Fatalf("expected every offered event to be enqueued under DropOldest (evicting makes room rather than rejecting), got %d want %d", stats.Enqueued, n)
+		}
+		if got := stats.Written + stats.Dropped; got != stats.Enqueued {
+			t.Fatalf("expected every enqueued event to be written or dropped, got written=%d dropped=%d (sum %d) enqueued=%d",
+				stats.Written, stats.Dropped, got, stats.Enqueued)
+		}
+	})
+}
+
+// TestFileSink_AsyncBuffer_DropOldest_ConcurrentNonBlocking checks that
+// DropOldest genuinely never blocks a producer, even with many goroutines
+// racing to evict and refill the same queue slots concurrently. Before the
+// eviction loop was introduced, a producer that lost the eviction race
+// could fall through to the same unconditional channel send BlockOnFull
+// uses, blocking until the writer goroutine made room - exactly the
+// behavior DropOldest exists to avoid under a bursty, concurrent workload.
+func TestFileSink_AsyncBuffer_DropOldest_ConcurrentNonBlocking(t *testing.T) {
+	fs := NewMemFS()
+	sink, err := NewFileSink("/var/log/audit.log", "json", WithFS(fs), WithAsyncBuffer(1, DropOldest))
+	if err != nil {
+		t.Fatalf("NewFileSink: %v", err)
+	}
+
+	const goroutines = 50
+	const perGoroutine = 200
+
+	done := make(chan struct{})
+	go func() {
+		var wg sync.WaitGroup
+		wg.Add(goroutines)
+		for i := 0; i < goroutines; i++ {
+			go func() {
+				defer wg.Done()
+				for j := 0; j < perGoroutine; j++ {
+					sink.enqueue([]byte("x"))
+				}
+			}()
+		}
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("enqueue under DropOldest blocked with concurrent producers; it must always make progress via non-blocking eviction")
+	}
+
+	if err := sink.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+}
+
+// TestMemFS_WritableFSContract exercises MemFS directly against the
+// WritableFS contract (open/write, stat, rename, glob, remove), independent
+// of FileSink, since FileSink's rotation tests above rely on all of these
+// behaving like a real filesystem.
+func TestMemFS_WritableFSContract(t *testing.T) {
+	fs := NewMemFS()
+
+	f, err := fs.OpenFile("/a/b.log", os.O_WRONLY|os.O_CREATE, 0o600)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	if _, err := f.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	info, err := fs.Stat("/a/b.log")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Size() != 5 {
+		t.Fatalf("expected size 5, got %d", info.Size())
+	}
+
+	if err := fs.Rename("/a/b.log", "/a/c.log"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if _, err := fs.Stat("/a/b.log"); !os.IsNotExist(err) {
+		t.Fatalf("expected old path to be gone after Rename, got err=%v", err)
+	}
+
+	matches, err := fs.Glob("/a/*.log")
+	if err != nil {
+		t.Fatalf("Glob: %v", err)
+	}
+	if len(matches) != 1 || matches[0] != "/a/c.log" {
+		t.Fatalf("unexpected Glob result: %v", matches)
+	}
+
+	if err := fs.Remove("/a/c.log"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if _, err := fs.Stat("/a/c.log"); !os.IsNotExist(err) {
+		t.Fatalf("expected removed path to be gone, got err=%v", err)
+	}
+}
+
+// TestFileSink_ReopenDuringRotation checks that Reopen (e.g. from a SIGHUP
+// handler) just cycles the current file descriptor without disturbing
+// rotation bookkeeping, using MemFS so the sequence is deterministic.
+func TestFileSink_ReopenDuringRotation(t *testing.T) {
+	fs := NewMemFS()
+	path := "/var/log/audit.log"
+
+	sink, err := NewFileSink(path, "json", WithFS(fs), WithRotateBytes(5))
+	if err != nil {
+		t.Fatalf("NewFileSink: %v", err)
+	}
+
+	if err := sink.log([]byte("12345")); err != nil {
+		t.Fatalf("log: %v", err)
+	}
+
+	if err := sink.Reopen(); err != nil {
+		t.Fatalf("Reopen: %v", err)
+	}
+
+	if err := sink.log([]byte("67890")); err != nil {
+		t.Fatalf("log: %v", err)
+	}
+
+	matches, err := fs.Glob(path + ".*")
+	if err != nil {
+		t.Fatalf("Glob: %v", err)
+	}
+	if len(matches) != 1 {
+		t.Fatalf("expected 1 rotated segment after Reopen plus a second full write, got %d: %v", len(matches), matches)
+	}
+}
+
+// TestFileSink_AtomicSegments_RejectsIncompatibleOptions checks that
+// combining WithAtomicSegments with an option it silently ignores
+// (rotate/compress/prune/advisory-lock) is rejected at construction time
+// instead of quietly doing nothing.
+func TestFileSink_AtomicSegments_RejectsIncompatibleOptions(t *testing.T) {
+	cases := []struct {
+		name string
+		opt  Option
+	}{
+		{"WithRotateBytes", WithRotateBytes(1024)},
+		{"WithRotateDuration", WithRotateDuration(time.Minute)},
+		{"WithMaxFiles", WithMaxFiles(5)},
+		{"WithCompress", WithCompress(true)},
+		{"WithFileLock", WithFileLock(true)},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := NewMemFS()
+			_, err := NewFileSink("/var/log/audit.log", "json", WithFS(fs), WithAtomicSegments(true), tc.opt)
+			if !errors.Is(err, ErrInvalidParameter) {
+				t.Fatalf("expected ErrInvalidParameter combining WithAtomicSegments with %s, got %v", tc.name, err)
+			}
+		})
+	}
+}
+
+// TestFileSink_AtomicSegments_ResumeAfterRestart reproduces the restart
+// scenario a basic test would have caught: a second FileSink constructed
+// against a path that already has atomic segments on it (e.g. after a
+// process restart) must continue the segment sequence and the hash chain
+// rather than renaming new segments over the existing ones.
+func TestFileSink_AtomicSegments_ResumeAfterRestart(t *testing.T) {
+	fs := NewMemFS()
+	path := "/var/log/audit.log"
+
+	first, err := NewFileSink(path, "json", WithFS(fs), WithAtomicSegments(true), WithHashChain("sha256"))
+	if err != nil {
+		t.Fatalf("NewFileSink (first): %v", err)
+	}
+
+	if err := first.log([]byte("event-1\n")); err != nil {
+		t.Fatalf("log: %v", err)
+	}
+	if err := first.log([]byte("event-2\n")); err != nil {
+		t.Fatalf("log: %v", err)
+	}
+
+	second, err := NewFileSink(path, "json", WithFS(fs), WithAtomicSegments(true), WithHashChain("sha256"))
+	if err != nil {
+		t.Fatalf("NewFileSink (second): %v", err)
+	}
+
+	if err := second.log([]byte("event-3\n")); err != nil {
+		t.Fatalf("log: %v", err)
+	}
+
+	matches, err := fs.Glob("/var/log/audit-*.log")
+	if err != nil {
+		t.Fatalf("Glob: %v", err)
+	}
+	if len(matches) != 3 {
+		t.Fatalf("expected the restarted sink to add a 3rd segment rather than overwrite, got %d: %v", len(matches), matches)
+	}
+
+	seg0 := readMemFile(t, fs, "/var/log/audit-000000.log")
+	if !strings.Contains(string(seg0), "event-1") {
+		t.Fatalf("segment 0 was overwritten by the restarted sink: %q", seg0)
+	}
+
+	seg1 := readMemFile(t, fs, "/var/log/audit-000001.log")
+	seg2 := readMemFile(t, fs, "/var/log/audit-000002.log")
+
+	wantHash := sha256.Sum256(seg1)
+	wantHeader := fmt.Sprintf("# prev-segment-hash: sha256:%s", hex.EncodeToString(wantHash[:]))
+	if !strings.HasPrefix(string(seg2), wantHeader) {
+		t.Fatalf("segment 2's hash chain header doesn't follow from segment 1; got %q, want prefix %q", seg2, wantHeader)
+	}
+}